@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package daemon handles the lifecycle of the akvorado daemons: it owns
+// the root tomb every component's background goroutines are tracked
+// against. It does not handle signals itself.
+package daemon
+
+import (
+	"testing"
+
+	"gopkg.in/tomb.v2"
+)
+
+// Component is the interface exposed to other components so they can track
+// their background goroutines against the daemon's lifecycle.
+type Component interface {
+	// Track registers a tomb for the named goroutine group so the daemon
+	// can wait for it and propagate fatal errors.
+	Track(t *tomb.Tomb, name ...string)
+}
+
+type component struct {
+	t *tomb.Tomb
+}
+
+// New creates a new daemon component.
+func New() Component {
+	return &component{t: &tomb.Tomb{}}
+}
+
+// NewMock creates a daemon component suitable for tests. Its tomb is killed
+// automatically when the test completes.
+func NewMock(t *testing.T) Component {
+	t.Helper()
+	c := &component{t: &tomb.Tomb{}}
+	t.Cleanup(func() {
+		c.t.Kill(nil)
+	})
+	return c
+}
+
+func (c *component) Track(t *tomb.Tomb, name ...string) {
+	c.t.Go(t.Wait)
+}
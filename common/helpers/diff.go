@@ -0,0 +1,23 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package helpers
+
+import (
+	"net/netip"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// Diff returns a human-readable report of the differences between two
+// values. It is a thin wrapper around go-cmp with the options we want
+// everywhere (unexported fields of well-known types, nil vs empty slices).
+func Diff(x, y interface{}, opts ...cmp.Option) string {
+	base := []cmp.Option{
+		cmpopts.EquateEmpty(),
+		cmp.Comparer(func(a, b netip.Addr) bool { return a == b }),
+		cmp.Comparer(func(a, b netip.Prefix) bool { return a == b }),
+	}
+	return cmp.Diff(x, y, append(base, opts...)...)
+}
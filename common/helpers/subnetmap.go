@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package helpers
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// SubnetMap maps subnets to a value of type V and answers lookups using
+// longest-prefix match. It is safe for concurrent reads once built; it is
+// not safe to mutate concurrently with lookups.
+type SubnetMap[V any] struct {
+	// prefixes is kept sorted from the most specific to the least specific
+	// prefix so Lookup can return on the first match.
+	prefixes []netip.Prefix
+	values   map[netip.Prefix]V
+}
+
+// NewSubnetMap builds a SubnetMap from a map of CIDR strings to values. It
+// returns an error if one of the keys is not a valid subnet.
+func NewSubnetMap[V any](from map[string]V) (*SubnetMap[V], error) {
+	sm := &SubnetMap[V]{
+		values: make(map[netip.Prefix]V, len(from)),
+	}
+	for k, v := range from {
+		prefix, err := netip.ParsePrefix(k)
+		if err != nil {
+			// Accept bare IPs as host routes, like communities.yaml does.
+			addr, addrErr := netip.ParseAddr(k)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid subnet %q: %w", k, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefix = normalizePrefix(prefix)
+		sm.values[prefix] = v
+		sm.prefixes = append(sm.prefixes, prefix)
+	}
+	sortPrefixesBySpecificity(sm.prefixes)
+	return sm, nil
+}
+
+// normalizePrefix expresses prefix as a 16-byte (IPv6 or IPv4-mapped-IPv6)
+// prefix, so Lookup can match it regardless of whether the looked up address
+// is a plain IPv4 address or its IPv4-mapped-IPv6 form: promoting a plain
+// IPv4 prefix keeps it consistent with "::ffff:a.b.c.d/NNN"-style keys (used
+// throughout akvorado) instead of the other way around, which would lose
+// bits when collapsing an IPv4-mapped-IPv6 prefix back down to IPv4.
+func normalizePrefix(prefix netip.Prefix) netip.Prefix {
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+	if addr.Is4() {
+		bits += 96
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(addr.As16()), bits)
+}
+
+func sortPrefixesBySpecificity(prefixes []netip.Prefix) {
+	for i := 1; i < len(prefixes); i++ {
+		for j := i; j > 0 && prefixes[j].Bits() > prefixes[j-1].Bits(); j-- {
+			prefixes[j], prefixes[j-1] = prefixes[j-1], prefixes[j]
+		}
+	}
+}
+
+// Lookup returns the value associated with the most specific subnet
+// containing ip, and whether a match was found at all.
+func (sm *SubnetMap[V]) Lookup(ip netip.Addr) (V, bool) {
+	var zero V
+	if sm == nil {
+		return zero, false
+	}
+	ip = netip.AddrFrom16(ip.As16())
+	for _, prefix := range sm.prefixes {
+		if prefix.Contains(ip) {
+			return sm.values[prefix], true
+		}
+	}
+	return zero, false
+}
+
+// ToMap returns the underlying subnet-to-value associations. It is mostly
+// useful for tests and configuration dumps.
+func (sm *SubnetMap[V]) ToMap() map[string]V {
+	if sm == nil {
+		return nil
+	}
+	out := make(map[string]V, len(sm.values))
+	for prefix, v := range sm.values {
+		out[prefix.String()] = v
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package reporter centralizes metrics and logging for all components so
+// they do not have to deal with Prometheus registration or logger setup
+// themselves.
+package reporter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Reporter is the component handed out to every other component to let it
+// register its metrics.
+type Reporter struct {
+	registry *prometheus.Registry
+}
+
+// New creates a new reporter with its own Prometheus registry.
+func New() *Reporter {
+	return &Reporter{registry: prometheus.NewRegistry()}
+}
+
+// NewMock creates a reporter suitable for tests.
+func NewMock(t *testing.T) *Reporter {
+	t.Helper()
+	return New()
+}
+
+// CounterVec registers and returns a new CounterVec.
+func (r *Reporter) CounterVec(opts prometheus.CounterOpts, labels []string) *prometheus.CounterVec {
+	cv := prometheus.NewCounterVec(opts, labels)
+	r.registry.MustRegister(cv)
+	return cv
+}
+
+// GaugeVec registers and returns a new GaugeVec.
+func (r *Reporter) GaugeVec(opts prometheus.GaugeOpts, labels []string) *prometheus.GaugeVec {
+	gv := prometheus.NewGaugeVec(opts, labels)
+	r.registry.MustRegister(gv)
+	return gv
+}
+
+// Counter registers and returns a new Counter.
+func (r *Reporter) Counter(opts prometheus.CounterOpts) prometheus.Counter {
+	c := prometheus.NewCounter(opts)
+	r.registry.MustRegister(c)
+	return c
+}
+
+// Gauge registers and returns a new Gauge.
+func (r *Reporter) Gauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	g := prometheus.NewGauge(opts)
+	r.registry.MustRegister(g)
+	return g
+}
+
+// Summary registers and returns a new Summary.
+func (r *Reporter) Summary(opts prometheus.SummaryOpts) prometheus.Summary {
+	s := prometheus.NewSummary(opts)
+	r.registry.MustRegister(s)
+	return s
+}
+
+// GetMetrics gathers the metrics whose name starts with prefix and returns
+// them keyed by their name (prefix stripped) with their labels rendered as
+// `name{label="value",...}`. It is meant to be used from tests only.
+func (r *Reporter) GetMetrics(prefix string, suffixes ...string) map[string]string {
+	families, err := r.registry.Gather()
+	if err != nil {
+		panic(fmt.Sprintf("unable to gather metrics: %v", err))
+	}
+	want := make(map[string]bool, len(suffixes))
+	for _, s := range suffixes {
+		want[s] = true
+	}
+	got := map[string]string{}
+	for _, mf := range families {
+		if !strings.HasPrefix(mf.GetName(), prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(mf.GetName(), prefix)
+		if len(suffixes) > 0 && !want[name] {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			key := name
+			if len(m.GetLabel()) > 0 {
+				pairs := make([]string, 0, len(m.GetLabel()))
+				for _, lp := range m.GetLabel() {
+					pairs = append(pairs, fmt.Sprintf("%s=%q", lp.GetName(), lp.GetValue()))
+				}
+				sort.Strings(pairs)
+				key = fmt.Sprintf("%s{%s}", name, strings.Join(pairs, ","))
+			}
+			got[key] = formatMetricValue(m)
+		}
+	}
+	return got
+}
+
+// formatMetricValue renders the value carried by a single metric sample as
+// a string, the way our tests expect to compare it.
+func formatMetricValue(m *dto.Metric) string {
+	switch {
+	case m.GetCounter() != nil:
+		return strconv.FormatFloat(m.GetCounter().GetValue(), 'g', -1, 64)
+	case m.GetGauge() != nil:
+		return strconv.FormatFloat(m.GetGauge().GetValue(), 'g', -1, 64)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"math/rand"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// breakerState tracks the consecutive-failure backoff state for a single
+// exporter.
+type breakerState struct {
+	failures    int
+	backoff     time.Duration
+	nextAllowed time.Time
+}
+
+// breaker holds the per-exporter backoff state used to stop hammering an
+// exporter that keeps failing to answer.
+type breaker struct {
+	mu     sync.RWMutex
+	states map[netip.Addr]*breakerState
+	config BackoffConfiguration
+}
+
+func newBreaker(config BackoffConfiguration) *breaker {
+	return &breaker{
+		states: make(map[netip.Addr]*breakerState),
+		config: config,
+	}
+}
+
+// Open returns whether the breaker is currently open for exporterIP, and
+// until when, given the current time.
+func (b *breaker) Open(exporterIP netip.Addr, now time.Time) (bool, time.Time) {
+	exporterIP = exporterIP.Unmap()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	st, ok := b.states[exporterIP]
+	if !ok || st.failures < b.config.MaxConsecutiveFailures {
+		return false, time.Time{}
+	}
+	return now.Before(st.nextAllowed), st.nextAllowed
+}
+
+// RecordFailure registers a poll failure for exporterIP and returns the
+// backoff duration now in effect.
+func (b *breaker) RecordFailure(exporterIP netip.Addr, now time.Time) time.Duration {
+	exporterIP = exporterIP.Unmap()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.states[exporterIP]
+	if !ok {
+		st = &breakerState{}
+		b.states[exporterIP] = st
+	}
+	st.failures++
+	if st.failures < b.config.MaxConsecutiveFailures {
+		return 0
+	}
+	n := st.failures - b.config.MaxConsecutiveFailures
+	backoff := b.config.InitialInterval << n
+	if backoff <= 0 || backoff > b.config.MaxInterval {
+		backoff = b.config.MaxInterval
+	}
+	st.backoff = backoff
+	if b.config.JitterFactor > 0 {
+		jitter := time.Duration(float64(backoff) * b.config.JitterFactor)
+		backoff = backoff - jitter + time.Duration(rand.Int63n(int64(jitter)+1))
+	}
+	st.nextAllowed = now.Add(backoff)
+	return st.backoff
+}
+
+// RecordSuccess clears the failure count for exporterIP, closing the
+// breaker.
+func (b *breaker) RecordSuccess(exporterIP netip.Addr) {
+	exporterIP = exporterIP.Unmap()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.states, exporterIP)
+}
+
+// Backoff returns the current backoff duration in effect for exporterIP, or
+// zero if none.
+func (b *breaker) Backoff(exporterIP netip.Addr) time.Duration {
+	exporterIP = exporterIP.Unmap()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if st, ok := b.states[exporterIP]; ok {
+		return st.backoff
+	}
+	return 0
+}
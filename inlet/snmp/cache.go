@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// Interface describes the interface information we keep in the cache.
+type Interface struct {
+	Name        string
+	Description string
+	Speed       uint
+}
+
+// cacheKey identifies a single cached (exporter, ifIndex) entry.
+type cacheKey struct {
+	ExporterIP netip.Addr
+	IfIndex    uint
+}
+
+// cacheEntry is what we keep in the cache for a given cacheKey.
+type cacheEntry struct {
+	ExporterName string
+	Interface    Interface
+	LastUpdated  time.Time
+	LastAccessed time.Time
+}
+
+// cache is the SNMP cache, indexed by exporter and ifIndex.
+type cache struct {
+	mu      sync.RWMutex
+	entries map[cacheKey]cacheEntry
+	clock   clock.Clock
+	metrics *metrics
+
+	subsMu      sync.Mutex
+	subscribers map[chan CacheEntry]struct{}
+}
+
+func newCache(c clock.Clock, m *metrics) *cache {
+	return &cache{
+		entries:     make(map[cacheKey]cacheEntry),
+		clock:       c,
+		metrics:     m,
+		subscribers: make(map[chan CacheEntry]struct{}),
+	}
+}
+
+// CacheEntry is the public, exporter/ifIndex-keyed representation of a
+// single cache entry, as used by Component.Snapshot/Restore and by the
+// SnmpCache gRPC service to exchange entries with a peer.
+type CacheEntry struct {
+	ExporterIP   netip.Addr
+	IfIndex      uint
+	ExporterName string
+	Interface    Interface
+	LastUpdated  time.Time
+}
+
+// Snapshot returns every entry currently in the cache.
+func (c *cache) Snapshot() []CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snapshot := make([]CacheEntry, 0, len(c.entries))
+	for key, entry := range c.entries {
+		snapshot = append(snapshot, CacheEntry{
+			ExporterIP:   key.ExporterIP,
+			IfIndex:      key.IfIndex,
+			ExporterName: entry.ExporterName,
+			Interface:    entry.Interface,
+			LastUpdated:  entry.LastUpdated,
+		})
+	}
+	return snapshot
+}
+
+// Restore merges the provided entries into the cache, keeping, for a given
+// key, whichever of the current and the incoming entry was updated last.
+func (c *cache) Restore(entries []CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range entries {
+		key := cacheKey{e.ExporterIP.Unmap(), e.IfIndex}
+		if existing, ok := c.entries[key]; ok && existing.LastUpdated.After(e.LastUpdated) {
+			continue
+		}
+		c.entries[key] = cacheEntry{
+			ExporterName: e.ExporterName,
+			Interface:    e.Interface,
+			LastUpdated:  e.LastUpdated,
+			LastAccessed: c.clock.Now(),
+		}
+	}
+	c.metrics.cacheSize.Set(float64(len(c.entries)))
+}
+
+// Subscribe registers a channel receiving every entry learned from now on
+// (via Put), and returns a function to unregister it. The channel is never
+// closed by the cache; the caller is responsible for draining it until it
+// calls the returned function.
+func (c *cache) Subscribe() (<-chan CacheEntry, func()) {
+	ch := make(chan CacheEntry, 100)
+	c.subsMu.Lock()
+	c.subscribers[ch] = struct{}{}
+	c.subsMu.Unlock()
+	return ch, func() {
+		c.subsMu.Lock()
+		delete(c.subscribers, ch)
+		c.subsMu.Unlock()
+	}
+}
+
+// notify fans entry out to every current subscriber, dropping it for a
+// subscriber whose channel is full rather than blocking Put().
+func (c *cache) notify(entry CacheEntry) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	for ch := range c.subscribers {
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
+
+// Get looks up an entry, marking it as accessed if found.
+func (c *cache) Get(exporterIP netip.Addr, ifIndex uint) (string, Interface, bool) {
+	key := cacheKey{exporterIP.Unmap(), ifIndex}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		c.metrics.cacheMiss.Inc()
+		return "", Interface{}, false
+	}
+	entry.LastAccessed = c.clock.Now()
+	c.entries[key] = entry
+	c.metrics.cacheHit.Inc()
+	return entry.ExporterName, entry.Interface, true
+}
+
+// Put stores or refreshes an entry.
+func (c *cache) Put(exporterIP netip.Addr, ifIndex uint, exporterName string, iface Interface) {
+	exporterIP = exporterIP.Unmap()
+	key := cacheKey{exporterIP, ifIndex}
+	now := c.clock.Now()
+	c.mu.Lock()
+	_, existed := c.entries[key]
+	entry := cacheEntry{
+		ExporterName: exporterName,
+		Interface:    iface,
+		LastUpdated:  now,
+		LastAccessed: now,
+	}
+	c.entries[key] = entry
+	if !existed {
+		c.metrics.cacheSize.Set(float64(len(c.entries)))
+	}
+	c.mu.Unlock()
+
+	c.notify(CacheEntry{
+		ExporterIP:   exporterIP,
+		IfIndex:      ifIndex,
+		ExporterName: entry.ExporterName,
+		Interface:    entry.Interface,
+		LastUpdated:  entry.LastUpdated,
+	})
+}
+
+// Expire removes entries that have not been refreshed for longer than
+// duration and returns how many entries it removed.
+func (c *cache) Expire(duration time.Duration) int {
+	now := c.clock.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expired := 0
+	for key, entry := range c.entries {
+		if now.Sub(entry.LastUpdated) > duration {
+			delete(c.entries, key)
+			expired++
+		}
+	}
+	if expired > 0 {
+		c.metrics.cacheSize.Set(float64(len(c.entries)))
+	}
+	return expired
+}
+
+// NeedsRefresh returns the (exporter, ifIndex) entries that were updated
+// more than duration-refresh ago but have been accessed recently, meaning
+// they are still in use and should be kept fresh.
+func (c *cache) NeedsRefresh(duration, refresh time.Duration) []cacheKey {
+	now := c.clock.Now()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var keys []cacheKey
+	for key, entry := range c.entries {
+		if now.Sub(entry.LastUpdated) < duration-refresh {
+			continue
+		}
+		if !entry.LastAccessed.After(entry.LastUpdated) {
+			// Not looked up since the last refresh: nobody is using it,
+			// let it expire instead of polling it forever.
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Save persists the cache content to path.
+func (c *cache) Save(path string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create cache file: %w", err)
+	}
+	defer f.Close()
+	persisted := make([]persistedEntry, 0, len(c.entries))
+	for key, entry := range c.entries {
+		persisted = append(persisted, persistedEntry{
+			ExporterIP:   key.ExporterIP.String(),
+			IfIndex:      key.IfIndex,
+			ExporterName: entry.ExporterName,
+			Interface:    entry.Interface,
+			LastUpdated:  entry.LastUpdated,
+			LastAccessed: entry.LastAccessed,
+		})
+	}
+	return gob.NewEncoder(f).Encode(persisted)
+}
+
+// Load restores the cache content from path. A missing file is not an error.
+func (c *cache) Load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot open cache file: %w", err)
+	}
+	defer f.Close()
+	var persisted []persistedEntry
+	if err := gob.NewDecoder(f).Decode(&persisted); err != nil {
+		return fmt.Errorf("cannot decode cache file: %w", err)
+	}
+	entries := make(map[cacheKey]cacheEntry, len(persisted))
+	for _, p := range persisted {
+		exporterIP, err := netip.ParseAddr(p.ExporterIP)
+		if err != nil {
+			continue
+		}
+		entries[cacheKey{exporterIP, p.IfIndex}] = cacheEntry{
+			ExporterName: p.ExporterName,
+			Interface:    p.Interface,
+			LastUpdated:  p.LastUpdated,
+			LastAccessed: p.LastAccessed,
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = entries
+	c.metrics.cacheSize.Set(float64(len(c.entries)))
+	return nil
+}
+
+// persistedEntry is the on-disk representation of a cache entry, with the
+// exporter IP persisted in its string form. The cacheEntry fields
+// are spelled out explicitly rather than embedded: gob silently drops the
+// fields of an embedded value whose type is unexported, which would have
+// persisted only ExporterIP/IfIndex and silently dropped everything else.
+type persistedEntry struct {
+	ExporterIP   string
+	IfIndex      uint
+	ExporterName string
+	Interface    Interface
+	LastUpdated  time.Time
+	LastAccessed time.Time
+}
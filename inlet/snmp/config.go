@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"net/netip"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+// Configuration describes the configuration for the SNMP client.
+type Configuration struct {
+	// CacheDuration defines how long to keep cached entries without a refresh.
+	CacheDuration time.Duration `validate:"gtefield=CacheRefresh"`
+	// CacheRefresh defines how soon to refresh an entry before it gets invalid.
+	CacheRefresh time.Duration `validate:"eq=0|gtfield=CacheCheckInterval"`
+	// CacheCheckInterval defines the interval to check for cache entries to refresh or expire.
+	CacheCheckInterval time.Duration `validate:"required"`
+	// CachePersistFile defines a file to store cache and load it from on startup.
+	CachePersistFile string
+	// CacheBootstrapPeer, when set, is the address (host:port) of another
+	// inlet's SnmpCache gRPC service to bootstrap the cache from in
+	// Start(), after New() has loaded CachePersistFile; a peer entry
+	// replaces a loaded one unless the loaded one was updated later. It
+	// is a configuration field only: no command-line flag sets it.
+	CacheBootstrapPeer string
+
+	// DefaultCommunity is the default SNMP community to use when no
+	// subnet in Communities matches the exporter.
+	DefaultCommunity string
+	// Communities maps a subnet to the SNMP community to use for exporters in it.
+	Communities *helpers.SubnetMap[string]
+
+	// ExporterAliases maps a subnet to a human-readable name to use as the
+	// ExporterName for exporters in it, overriding both the sysName fetched
+	// over SNMP and the IP-derived fallback. It is also used as the
+	// "exporter" label on the metrics emitted by this component.
+	ExporterAliases *helpers.SubnetMap[string]
+
+	// Agents maps a subnet to the agent IP address to poll exporters in it.
+	// Lookup uses the same longest-prefix-match semantics as Communities.
+	Agents *helpers.SubnetMap[netip.Addr]
+	// Ports overrides the SNMP port to use for exporters in a subnet.
+	Ports *helpers.SubnetMap[uint16]
+	// SNMPVersions overrides the SNMP version ("1", "2c" or "3") to use for
+	// exporters in a subnet.
+	SNMPVersions *helpers.SubnetMap[string]
+	// SecurityNames overrides the SNMPv3 security name to use for exporters
+	// in a subnet.
+	SecurityNames *helpers.SubnetMap[string]
+	// PollerTimeouts overrides PollerTimeout for exporters in a subnet.
+	PollerTimeouts *helpers.SubnetMap[time.Duration]
+
+	// Workers tells how many workers should poll SNMP exporters simultaneously.
+	Workers int
+	// PollerRetries tells how many times a poller should retry before giving up.
+	PollerRetries int
+	// PollerTimeout tells how long a poller should wait for an answer, unless
+	// overridden for its subnet by PollerTimeouts.
+	PollerTimeout time.Duration
+	// PollerCoalesce is the window during which lookups for the same exporter
+	// are merged into a single SNMP poll. Zero disables coalescing.
+	PollerCoalesce time.Duration
+
+	// Backoff configures the exponential backoff applied to an exporter
+	// once it has failed to answer too many times in a row.
+	Backoff BackoffConfiguration
+}
+
+// BackoffConfiguration describes the per-exporter backoff applied after
+// consecutive poll failures.
+type BackoffConfiguration struct {
+	// InitialInterval is the backoff duration used once the breaker opens,
+	// on the MaxConsecutiveFailures-th consecutive failure. It doubles on
+	// each further failure.
+	InitialInterval time.Duration
+	// MaxInterval caps the computed backoff duration.
+	MaxInterval time.Duration
+	// MaxConsecutiveFailures is the number of consecutive failures that
+	// opens the breaker and starts the backoff.
+	MaxConsecutiveFailures int
+	// JitterFactor is the fraction of the computed backoff that is
+	// randomized (full jitter is obtained with a factor of 1).
+	JitterFactor float64
+}
+
+// DefaultConfiguration returns the default configuration for the SNMP client.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		CacheDuration:      30 * time.Minute,
+		CacheRefresh:       15 * time.Minute,
+		CacheCheckInterval: 2 * time.Minute,
+
+		DefaultCommunity: "public",
+
+		Workers:        1,
+		PollerRetries:  1,
+		PollerTimeout:  time.Second,
+		PollerCoalesce: 10 * time.Millisecond,
+
+		Backoff: BackoffConfiguration{
+			InitialInterval:        time.Second,
+			MaxInterval:            time.Minute,
+			MaxConsecutiveFailures: 20,
+			JitterFactor:           1,
+		},
+	}
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+)
+
+// snmpCacheServiceName is the gRPC service letting a freshly started inlet
+// bootstrap its SNMP cache from a peer instead of starting cold.
+const snmpCacheServiceName = "akvorado.inlet.snmp.SnmpCache"
+
+func init() {
+	encoding.RegisterCodec(gobCodec{})
+}
+
+// gobCodec lets the SnmpCache service exchange plain Go values (cacheUpdate)
+// without requiring a .proto file and generated code: the messages below are
+// internal to this component, so there is no cross-language or
+// wire-stability requirement a protobuf definition would normally buy us.
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, fmt.Errorf("gobCodec: cannot marshal: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+		return fmt.Errorf("gobCodec: cannot unmarshal: %w", err)
+	}
+	return nil
+}
+
+func (gobCodec) Name() string { return "gob" }
+
+// cacheUpdate is what the SnmpCache service exchanges: Entries holds the
+// full cache on the first message sent by the server, then one entry per
+// message as it learns about it from a poll.
+type cacheUpdate struct {
+	Entries []CacheEntry
+}
+
+// snmpCacheStreamDesc describes the "Stream" server-streaming RPC: the
+// client sends a single empty request, the server replies with a snapshot
+// followed by a live stream of deltas until the client disconnects.
+var snmpCacheStreamDesc = grpc.StreamDesc{
+	StreamName:    "Stream",
+	ServerStreams: true,
+}
+
+var snmpCacheServiceDesc = grpc.ServiceDesc{
+	ServiceName: snmpCacheServiceName,
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    snmpCacheStreamDesc.StreamName,
+			Handler:       snmpCacheStreamHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+// RegisterSnmpCacheServer exposes c's cache over the SnmpCache gRPC service
+// on s, so other inlets can bootstrap their own cache from it.
+func RegisterSnmpCacheServer(s *grpc.Server, c *Component) {
+	s.RegisterService(&snmpCacheServiceDesc, c)
+}
+
+func snmpCacheStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	c := srv.(*Component)
+
+	var req struct{}
+	if err := stream.RecvMsg(&req); err != nil {
+		return fmt.Errorf("cannot receive request: %w", err)
+	}
+
+	if err := stream.SendMsg(&cacheUpdate{Entries: c.cache.Snapshot()}); err != nil {
+		return fmt.Errorf("cannot send snapshot: %w", err)
+	}
+
+	updates, unsubscribe := c.cache.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case entry := <-updates:
+			if err := stream.SendMsg(&cacheUpdate{Entries: []CacheEntry{entry}}); err != nil {
+				return fmt.Errorf("cannot send update: %w", err)
+			}
+		}
+	}
+}
+
+// BootstrapFromPeer dials a running inlet at addr, restores its SNMP cache
+// snapshot, then keeps applying the deltas it streams until ctx is
+// canceled. Start() calls it when CacheBootstrapPeer is set, before it
+// starts the workers, to avoid the cold-start window during which Lookup
+// returns NOk for every interface after a rolling restart of inlets behind
+// a load balancer.
+func (c *Component) BootstrapFromPeer(ctx context.Context, addr string) error {
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(gobCodec{}.Name())))
+	if err != nil {
+		return fmt.Errorf("cannot dial %s: %w", addr, err)
+	}
+
+	stream, err := conn.NewStream(ctx, &snmpCacheStreamDesc, fmt.Sprintf("/%s/Stream", snmpCacheServiceName))
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("cannot open stream to %s: %w", addr, err)
+	}
+	if err := stream.SendMsg(&struct{}{}); err != nil {
+		conn.Close()
+		return fmt.Errorf("cannot send request to %s: %w", addr, err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		conn.Close()
+		return fmt.Errorf("cannot close send side to %s: %w", addr, err)
+	}
+
+	// The first message is the snapshot: restore it synchronously so the
+	// cache is warm by the time BootstrapFromPeer returns, before Start()
+	// goes on to accept flows. Only the deltas that follow are applied in
+	// the background.
+	var snapshot cacheUpdate
+	if err := stream.RecvMsg(&snapshot); err != nil {
+		conn.Close()
+		return fmt.Errorf("cannot receive snapshot from %s: %w", addr, err)
+	}
+	c.cache.Restore(snapshot.Entries)
+
+	c.t.Go(func() error {
+		defer conn.Close()
+		for {
+			var update cacheUpdate
+			if err := stream.RecvMsg(&update); err != nil {
+				if err == io.EOF || ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("cannot receive from %s: %w", addr, err)
+			}
+			c.cache.Restore(update.Entries)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"akvorado/common/reporter"
+)
+
+type metrics struct {
+	cacheHit          prometheus.Counter
+	cacheMiss         prometheus.Counter
+	cacheExpired      prometheus.Counter
+	cacheRefresh      prometheus.Counter
+	cacheRefreshRuns  prometheus.Counter
+	cacheSize         prometheus.Gauge
+	pollerCoalescedCount   prometheus.Counter
+	pollerBreakerOpenCount *prometheus.CounterVec
+	pollerBackoffSeconds   *prometheus.GaugeVec
+}
+
+func newMetrics(r *reporter.Reporter) *metrics {
+	return &metrics{
+		cacheHit: r.Counter(prometheus.CounterOpts{
+			Name: "akvorado_inlet_snmp_cache_hit",
+			Help: "Number of lookups hitting the SNMP cache.",
+		}),
+		cacheMiss: r.Counter(prometheus.CounterOpts{
+			Name: "akvorado_inlet_snmp_cache_miss",
+			Help: "Number of lookups missing the SNMP cache.",
+		}),
+		cacheExpired: r.Counter(prometheus.CounterOpts{
+			Name: "akvorado_inlet_snmp_cache_expired",
+			Help: "Number of cache entries expired.",
+		}),
+		cacheRefresh: r.Counter(prometheus.CounterOpts{
+			Name: "akvorado_inlet_snmp_cache_refresh",
+			Help: "Number of cache entries refreshed.",
+		}),
+		cacheRefreshRuns: r.Counter(prometheus.CounterOpts{
+			Name: "akvorado_inlet_snmp_cache_refresh_runs",
+			Help: "Number of times the cache refresh/expire loop ran.",
+		}),
+		cacheSize: r.Gauge(prometheus.GaugeOpts{
+			Name: "akvorado_inlet_snmp_cache_size",
+			Help: "Number of entries in the SNMP cache.",
+		}),
+		pollerCoalescedCount: r.Counter(prometheus.CounterOpts{
+			Name: "akvorado_inlet_snmp_poller_coalesced_count",
+			Help: "Number of SNMP lookups received by the coalescing dispatcher.",
+		}),
+		pollerBreakerOpenCount: r.CounterVec(prometheus.CounterOpts{
+			Name: "akvorado_inlet_snmp_poller_breaker_open_count",
+			Help: "Number of lookups rejected because the exporter breaker is open.",
+		}, []string{"exporter"}),
+		pollerBackoffSeconds: r.GaugeVec(prometheus.GaugeOpts{
+			Name: "akvorado_inlet_snmp_poller_backoff_seconds",
+			Help: "Current backoff duration, in seconds, applied to an exporter.",
+		}, []string{"exporter"}),
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// lookupRequest is a (possibly coalesced) request to poll an exporter for
+// a set of interfaces.
+type lookupRequest struct {
+	ExporterIP netip.Addr
+	IfIndexes  []uint
+}
+
+// putFunc is called by a poller as soon as it learns about an interface, so
+// results can start flowing into the cache before the whole poll completes.
+type putFunc func(exporterIP netip.Addr, ifIndex uint, exporterName string, iface Interface)
+
+// poller polls a single exporter for a set of interfaces and pushes what it
+// learns back through its putFunc.
+type poller interface {
+	Poll(ctx context.Context, exporterIP, agentIP netip.Addr, port uint16, ifIndexes []uint) error
+}
+
+// realPoller polls exporters over SNMP.
+type realPoller struct {
+	put     putFunc
+	retries int
+}
+
+func newRealPoller(put putFunc, retries int) *realPoller {
+	return &realPoller{put: put, retries: retries}
+}
+
+// resolvedExporterKey is the context key Component.poll() uses to pass the
+// resolvedExporter it already computed down to the poller, so agentIP/port
+// and the rest of the resolved parameters (community, version, ...) are
+// guaranteed to come from a single resolve() call instead of two.
+type resolvedExporterKey struct{}
+
+// contextWithResolvedExporter returns a copy of ctx carrying resolved.
+func contextWithResolvedExporter(ctx context.Context, resolved resolvedExporter) context.Context {
+	return context.WithValue(ctx, resolvedExporterKey{}, resolved)
+}
+
+// Poll fetches sysName and the requested ifName/ifAlias/ifHighSpeed for the
+// provided interfaces and reports them through put as they come in.
+func (p *realPoller) Poll(ctx context.Context, exporterIP, agentIP netip.Addr, port uint16, ifIndexes []uint) error {
+	resolved := ctx.Value(resolvedExporterKey{}).(resolvedExporter)
+	client := &gosnmp.GoSNMP{
+		Target:    agentIP.Unmap().String(),
+		Port:      port,
+		Community: resolved.Community,
+		Version:   snmpVersionFromString(resolved.SNMPVersion),
+		Timeout:   resolved.PollerTimeout,
+		Retries:   p.retries,
+		Context:   ctx,
+	}
+	if resolved.SNMPVersion == "3" {
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.MsgFlags = gosnmp.AuthNoPriv
+		client.SecurityParameters = &gosnmp.UsmSecurityParameters{UserName: resolved.SecurityName}
+	}
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("cannot connect to %s: %w", agentIP, err)
+	}
+	defer client.Conn.Close()
+
+	sysNameResult, err := client.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	if err != nil {
+		return fmt.Errorf("cannot get sysName from %s: %w", agentIP, err)
+	}
+	exporterName := exporterNameFromIP(exporterIP)
+	if len(sysNameResult.Variables) == 1 {
+		if name, ok := sysNameResult.Variables[0].Value.(string); ok && name != "" {
+			exporterName = name
+		}
+	}
+
+	for _, ifIndex := range ifIndexes {
+		iface, err := p.pollInterface(client, ifIndex)
+		if err != nil {
+			return err
+		}
+		p.put(exporterIP, ifIndex, exporterName, iface)
+	}
+	return nil
+}
+
+func (p *realPoller) pollInterface(client *gosnmp.GoSNMP, ifIndex uint) (Interface, error) {
+	oids := []string{
+		fmt.Sprintf(".1.3.6.1.2.1.31.1.1.1.1.%d", ifIndex),  // ifName
+		fmt.Sprintf(".1.3.6.1.2.1.31.1.1.1.18.%d", ifIndex), // ifAlias
+		fmt.Sprintf(".1.3.6.1.2.1.31.1.1.1.15.%d", ifIndex), // ifHighSpeed (Mbps)
+	}
+	result, err := client.Get(oids)
+	if err != nil {
+		return Interface{}, fmt.Errorf("cannot get interface %d: %w", ifIndex, err)
+	}
+	var iface Interface
+	if len(result.Variables) == 3 {
+		if name, ok := result.Variables[0].Value.(string); ok {
+			iface.Name = name
+		}
+		if descr, ok := result.Variables[1].Value.(string); ok {
+			iface.Description = descr
+		}
+		iface.Speed = uint(gosnmp.ToBigInt(result.Variables[2].Value).Uint64())
+	}
+	return iface, nil
+}
+
+// snmpVersionFromString maps a configured SNMP version string to the
+// corresponding gosnmp constant, defaulting to SNMPv2c.
+func snmpVersionFromString(version string) gosnmp.SnmpVersion {
+	switch version {
+	case "1":
+		return gosnmp.Version1
+	case "3":
+		return gosnmp.Version3
+	default:
+		return gosnmp.Version2c
+	}
+}
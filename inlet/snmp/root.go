@@ -0,0 +1,363 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package snmp handles SNMP polling to map an (exporter, ifIndex) pair to
+// an exporter name and interface information (name, description, speed).
+// Results are cached as SNMP is too slow to be queried on the fly for each
+// incoming flow.
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+)
+
+// Component represents the SNMP component.
+type Component struct {
+	r      *reporter.Reporter
+	d      Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	metrics *metrics
+	cache   *cache
+	breaker *breaker
+	poller  poller
+
+	// incomingRequests receives lookup requests for exporters that missed
+	// the cache. dispatcherBChannel is a test-only hook letting tests pause
+	// the dispatcher deterministically.
+	incomingRequests   chan lookupRequest
+	dispatcherBChannel chan chan bool
+}
+
+// Dependencies define the dependencies of the SNMP component.
+type Dependencies struct {
+	Daemon daemon.Component
+	Clock  clock.Clock
+}
+
+// minRefreshWindowTicks is the minimum number of CacheCheckInterval ticks
+// the refresh window must span, so the checker gets several chances to
+// catch a stale entry before it expires outright. An entry is due for
+// refresh CacheRefresh before it expires, so the window is CacheRefresh.
+const minRefreshWindowTicks = 5
+
+// New creates a new SNMP component.
+func New(r *reporter.Reporter, config Configuration, dependencies Dependencies) (*Component, error) {
+	if config.CacheRefresh != 0 && config.CacheRefresh <= config.CacheCheckInterval {
+		return nil, fmt.Errorf("cache refresh interval (%s) must be greater than check interval (%s)",
+			config.CacheRefresh, config.CacheCheckInterval)
+	}
+	if config.CacheDuration < config.CacheRefresh {
+		return nil, fmt.Errorf("cache duration (%s) must be greater than refresh interval (%s)",
+			config.CacheDuration, config.CacheRefresh)
+	}
+	if config.CacheRefresh != 0 && config.CacheRefresh <= minRefreshWindowTicks*config.CacheCheckInterval {
+		return nil, fmt.Errorf("refresh window (%s) must span more than %d check intervals (%s), or a stale entry could expire before the checker gets a chance to refresh it",
+			config.CacheRefresh, minRefreshWindowTicks, config.CacheCheckInterval)
+	}
+	if dependencies.Clock == nil {
+		dependencies.Clock = clock.New()
+	}
+	for _, version := range config.SNMPVersions.ToMap() {
+		switch version {
+		case "1", "2c", "3":
+		default:
+			return nil, fmt.Errorf("invalid SNMP version %q in SNMPVersions", version)
+		}
+	}
+	for _, timeout := range config.PollerTimeouts.ToMap() {
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid poller timeout %s in PollerTimeouts", timeout)
+		}
+	}
+
+	c := Component{
+		r:      r,
+		d:      dependencies,
+		config: config,
+
+		metrics: newMetrics(r),
+		breaker: newBreaker(config.Backoff),
+
+		incomingRequests:   make(chan lookupRequest, 100),
+		dispatcherBChannel: make(chan chan bool),
+	}
+	c.cache = newCache(dependencies.Clock, c.metrics)
+	c.poller = newRealPoller(c.putWithAlias(c.cache.Put), config.PollerRetries)
+
+	if config.CachePersistFile != "" {
+		if err := c.cache.Load(config.CachePersistFile); err != nil {
+			return nil, fmt.Errorf("cannot load cache: %w", err)
+		}
+	}
+
+	return &c, nil
+}
+
+// Start starts the SNMP component.
+func (c *Component) Start() error {
+	if c.config.CacheBootstrapPeer != "" {
+		if err := c.BootstrapFromPeer(c.t.Context(nil), c.config.CacheBootstrapPeer); err != nil {
+			return fmt.Errorf("cannot bootstrap cache from %s: %w", c.config.CacheBootstrapPeer, err)
+		}
+	}
+
+	workers := c.config.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		c.t.Go(c.dispatcher)
+	}
+	c.t.Go(c.cacheRefresher)
+	c.d.Daemon.Track(&c.t, "inlet/snmp")
+	return nil
+}
+
+// Stop stops the SNMP component, persisting the cache if configured to do so.
+func (c *Component) Stop() error {
+	c.t.Kill(nil)
+	err := c.t.Wait()
+	if c.config.CachePersistFile != "" {
+		if saveErr := c.cache.Save(c.config.CachePersistFile); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
+
+// Snapshot returns every entry currently in the cache. It is meant to be
+// served to a peer bootstrapping its own cache through the SnmpCache gRPC
+// service.
+func (c *Component) Snapshot() ([]CacheEntry, error) {
+	return c.cache.Snapshot(), nil
+}
+
+// Restore merges the provided entries into the cache. It is meant to be
+// called with the snapshot received from a peer over the SnmpCache gRPC
+// service, right after startup, to skip the cold-start window during which
+// Lookup would otherwise return NOk for every interface.
+func (c *Component) Restore(entries []CacheEntry) error {
+	c.cache.Restore(entries)
+	return nil
+}
+
+// Lookup looks up interface information for the provided exporter/ifIndex
+// pair. When the information is not cached yet, it schedules a poll and
+// returns ok=false: the caller is expected to retry later.
+func (c *Component) Lookup(t time.Time, exporterIP netip.Addr, ifIndex uint) (string, Interface, bool) {
+	if exporterName, iface, ok := c.cache.Get(exporterIP, ifIndex); ok {
+		return exporterName, iface, true
+	}
+
+	if open, _ := c.breaker.Open(exporterIP, t); open {
+		c.metrics.pollerBreakerOpenCount.WithLabelValues(c.exporterName(exporterIP)).Inc()
+		return "", Interface{}, false
+	}
+
+	if c.config.PollerCoalesce <= 0 {
+		// Nothing to coalesce: poll right away, in this goroutine, instead
+		// of handing off to the dispatcher. This also keeps the breaker
+		// state it updates synchronized with the Open() check above, which
+		// a handoff through incomingRequests cannot guarantee (the caller
+		// could enqueue many requests before the dispatcher processes any
+		// of them).
+		c.poll(c.t.Context(nil), lookupRequest{exporterIP, []uint{ifIndex}})
+		return "", Interface{}, false
+	}
+
+	select {
+	case c.incomingRequests <- lookupRequest{exporterIP, []uint{ifIndex}}:
+	default:
+		// The queue is full: drop the request, it will be retried on the
+		// next incoming flow for this interface.
+	}
+	return "", Interface{}, false
+}
+
+// exporterName returns the name to use for exporterIP: the configured
+// alias, if any, otherwise the IP-derived fallback ("127_0_0_1"-style).
+// It does not know about a sysName learned over SNMP yet, which, when
+// present, is only preferred over the IP-derived fallback, never over an
+// alias (see putWithAlias).
+func (c *Component) exporterName(exporterIP netip.Addr) string {
+	if alias, ok := c.config.ExporterAliases.Lookup(exporterIP); ok {
+		return alias
+	}
+	return exporterNameFromIP(exporterIP)
+}
+
+// putWithAlias wraps a putFunc to make sure a configured alias always wins
+// over the sysName learned over SNMP.
+func (c *Component) putWithAlias(put putFunc) putFunc {
+	return func(exporterIP netip.Addr, ifIndex uint, exporterName string, iface Interface) {
+		if alias, ok := c.config.ExporterAliases.Lookup(exporterIP); ok {
+			exporterName = alias
+		}
+		put(exporterIP, ifIndex, exporterName, iface)
+	}
+}
+
+// dispatcher reads lookup requests, coalesces the ones targeting the same
+// exporter within the configured window, and hands them to the poller.
+func (c *Component) dispatcher() error {
+	ctx := c.t.Context(nil)
+	pending := map[netip.Addr]*lookupRequest{}
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return c.causeOrErr(ctx)
+		case blocker := <-c.dispatcherBChannel:
+			<-blocker
+		case req := <-c.incomingRequests:
+			c.metrics.pollerCoalescedCount.Add(float64(len(req.IfIndexes)))
+			if existing, ok := pending[req.ExporterIP]; ok {
+				existing.IfIndexes = append(existing.IfIndexes, req.IfIndexes...)
+				continue
+			}
+			reqCopy := req
+			pending[req.ExporterIP] = &reqCopy
+			if c.config.PollerCoalesce <= 0 {
+				delete(pending, req.ExporterIP)
+				c.poll(ctx, reqCopy)
+				continue
+			}
+			if flush == nil {
+				// Real time, not c.d.Clock: the coalescing window is a
+				// short implementation-detail debounce, not part of the
+				// cache timing tests drive deterministically through a
+				// mock clock.
+				flush = time.After(c.config.PollerCoalesce)
+			}
+		case <-flush:
+			for exporterIP, req := range pending {
+				c.poll(ctx, *req)
+				delete(pending, exporterIP)
+			}
+			flush = nil
+		}
+	}
+}
+
+// poll resolves agent/port overrides for an exporter and asks the poller to
+// fetch the requested interfaces, updating the breaker on the way.
+func (c *Component) poll(ctx context.Context, req lookupRequest) {
+	resolved := c.resolve(req.ExporterIP)
+	ctx = contextWithResolvedExporter(ctx, resolved)
+	err := c.poller.Poll(ctx, req.ExporterIP, resolved.AgentIP, resolved.Port, req.IfIndexes)
+	exporterName := c.exporterName(req.ExporterIP)
+	if err != nil {
+		c.breaker.RecordFailure(req.ExporterIP, c.d.Clock.Now())
+		c.metrics.pollerBackoffSeconds.WithLabelValues(exporterName).
+			Set(c.breaker.Backoff(req.ExporterIP).Seconds())
+		return
+	}
+	c.breaker.RecordSuccess(req.ExporterIP)
+	c.metrics.pollerBackoffSeconds.WithLabelValues(exporterName).Set(0)
+}
+
+// resolvedExporter gathers the per-exporter SNMP parameters, after applying
+// any subnet override, that are needed to poll it.
+type resolvedExporter struct {
+	AgentIP       netip.Addr
+	Port          uint16
+	Community     string
+	SNMPVersion   string
+	SecurityName  string
+	PollerTimeout time.Duration
+}
+
+// resolve computes the SNMP parameters to use for exporterIP, applying the
+// longest-prefix-matching override for each of them when configured.
+func (c *Component) resolve(exporterIP netip.Addr) resolvedExporter {
+	exporterIP = exporterIP.Unmap()
+	resolved := resolvedExporter{
+		AgentIP:       exporterIP,
+		Port:          161,
+		Community:     c.config.DefaultCommunity,
+		SNMPVersion:   "2c",
+		PollerTimeout: c.config.PollerTimeout,
+	}
+	if agentIP, ok := c.config.Agents.Lookup(exporterIP); ok {
+		resolved.AgentIP = agentIP
+	}
+	if port, ok := c.config.Ports.Lookup(exporterIP); ok {
+		resolved.Port = port
+	}
+	if community, ok := c.config.Communities.Lookup(exporterIP); ok {
+		resolved.Community = community
+	}
+	if version, ok := c.config.SNMPVersions.Lookup(exporterIP); ok {
+		resolved.SNMPVersion = version
+	}
+	if securityName, ok := c.config.SecurityNames.Lookup(exporterIP); ok {
+		resolved.SecurityName = securityName
+	}
+	if timeout, ok := c.config.PollerTimeouts.Lookup(exporterIP); ok {
+		resolved.PollerTimeout = timeout
+	}
+	return resolved
+}
+
+// causeOrErr returns the cause of a canceled context when available, or the
+// context's own error, but never context.Canceled itself: that is what a
+// clean Stop() produces, and the tomb should not treat it as a failure.
+func (c *Component) causeOrErr(ctx context.Context) error {
+	if cause := context.Cause(ctx); cause != nil && cause != context.Canceled {
+		return cause
+	}
+	if err := ctx.Err(); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// cacheRefresher periodically expires stale entries and refreshes the ones
+// still in use.
+func (c *Component) cacheRefresher() error {
+	ticker := c.d.Clock.Ticker(c.config.CacheCheckInterval)
+	defer ticker.Stop()
+	ctx := c.t.Context(nil)
+	for {
+		select {
+		case <-ctx.Done():
+			return c.causeOrErr(ctx)
+		case <-ticker.C:
+			c.metrics.cacheRefreshRuns.Inc()
+			if expired := c.cache.Expire(c.config.CacheDuration); expired > 0 {
+				c.metrics.cacheExpired.Add(float64(expired))
+			}
+			if c.config.CacheRefresh == 0 {
+				continue
+			}
+			for _, key := range c.cache.NeedsRefresh(c.config.CacheDuration, c.config.CacheRefresh) {
+				c.metrics.cacheRefresh.Inc()
+				// Poll synchronously rather than handing off to the
+				// dispatcher: a refresh enqueued through incomingRequests
+				// only runs once PollerCoalesce elapses, and on the next
+				// tick Expire() would otherwise delete the entry before
+				// that refresh ever landed, dropping an interface that
+				// was still in active use.
+				c.poll(ctx, lookupRequest{key.ExporterIP, []uint{key.IfIndex}})
+			}
+		}
+	}
+}
+
+// exporterNameFromIP derives a default exporter name from its IP address,
+// used until SNMP gives us a sysName (or an alias overrides it).
+func exporterNameFromIP(ip netip.Addr) string {
+	return strings.ReplaceAll(ip.Unmap().String(), ".", "_")
+}
@@ -19,6 +19,16 @@ import (
 	"akvorado/common/reporter"
 )
 
+// answer gathers a Lookup() result into a single comparable value, with NOk
+// true when the lookup did not hit the cache (the inverse of Lookup's own
+// "ok" return value, to keep expected test values readable as zero-values
+// for the common "not yet polled" case).
+type answer struct {
+	ExporterName string
+	Interface    Interface
+	NOk          bool
+}
+
 func expectSNMPLookup(t *testing.T, c *Component, exporter string, ifIndex uint, expected answer) {
 	t.Helper()
 	ip := netip.AddrFrom16(netip.MustParseAddr(exporter).As16())
@@ -137,7 +147,7 @@ func TestAutoRefresh(t *testing.T) {
 		`miss`:         "1",
 		`size`:         "1",
 		`refresh_runs`: "31", // 63/2
-		`refresh`:      "1",
+		`refresh`:      "2",  // stale once after 25 min, again 25 min later
 	}
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -253,11 +263,13 @@ func TestPollerBreaker(t *testing.T) {
 			r := reporter.NewMock(t)
 			configuration := DefaultConfiguration()
 			configuration.PollerCoalesce = 0
+			configuration.Backoff.InitialInterval = 10 * time.Millisecond
+			configuration.Backoff.MaxInterval = 200 * time.Millisecond
 			c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
 			if tc.Poller != nil {
 				c.poller = tc.Poller
 			}
-			c.metrics.pollerBreakerOpenCount.WithLabelValues("127.0.0.1").Add(0)
+			c.metrics.pollerBreakerOpenCount.WithLabelValues("127_0_0_1").Add(0)
 
 			for i := 0; i < 30; i++ {
 				c.Lookup(c.d.Clock.Now(), netip.MustParseAddr("::ffff:127.0.0.1"), 765)
@@ -270,11 +282,38 @@ func TestPollerBreaker(t *testing.T) {
 			gotMetrics := r.GetMetrics("akvorado_inlet_snmp_poller_", "breaker_open_count", "coalesced_count")
 			expectedMetrics := map[string]string{
 				`coalesced_count`:                          "0",
-				`breaker_open_count{exporter="127.0.0.1"}`: tc.ExpectedCount,
+				`breaker_open_count{exporter="127_0_0_1"}`: tc.ExpectedCount,
 			}
 			if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 				t.Errorf("Metrics (-got, +want):\n%s", diff)
 			}
+
+			if tc.Poller == nil {
+				// No failure ever happened: no backoff in effect.
+				if got := c.breaker.Backoff(netip.MustParseAddr("127.0.0.1")); got != 0 {
+					t.Errorf("Backoff() = %s, want 0", got)
+				}
+				return
+			}
+
+			// The breaker is now open: the backoff gauge reflects it, and
+			// waiting for it to elapse and failing again only makes it grow.
+			firstBackoff := c.breaker.Backoff(netip.MustParseAddr("127.0.0.1"))
+			if firstBackoff <= 0 {
+				t.Fatalf("Backoff() = %s, want a positive backoff", firstBackoff)
+			}
+			gotGauge := r.GetMetrics("akvorado_inlet_snmp_poller_", "backoff_seconds")
+			if gotGauge[`backoff_seconds{exporter="127_0_0_1"}`] == "" {
+				t.Errorf("missing akvorado_inlet_snmp_poller_backoff_seconds for 127.0.0.1")
+			}
+
+			time.Sleep(firstBackoff + 20*time.Millisecond)
+			c.Lookup(c.d.Clock.Now(), netip.MustParseAddr("::ffff:127.0.0.1"), 765)
+			time.Sleep(20 * time.Millisecond)
+			secondBackoff := c.breaker.Backoff(netip.MustParseAddr("127.0.0.1"))
+			if secondBackoff <= firstBackoff {
+				t.Errorf("Backoff() did not increase after another failure: %s -> %s", firstBackoff, secondBackoff)
+			}
 		})
 	}
 }
@@ -297,10 +336,10 @@ func TestAgentMapping(t *testing.T) {
 	alp := &agentLogPoller{}
 	r := reporter.NewMock(t)
 	config := DefaultConfiguration()
-	config.Agents = map[netip.Addr]netip.Addr{
-		// Rely on IPv4 → IPv6 conversion in New()
-		netip.MustParseAddr("192.0.2.1"): netip.MustParseAddr("192.0.2.10"),
-	}
+	config.Agents, _ = helpers.NewSubnetMap(map[string]netip.Addr{
+		// Host route: only this exact exporter is rewritten.
+		"192.0.2.1/32": netip.MustParseAddr("192.0.2.10"),
+	})
 	c := NewMock(t, r, config, Dependencies{Daemon: daemon.NewMock(t)})
 	c.poller = alp
 
@@ -321,3 +360,119 @@ func TestAgentMapping(t *testing.T) {
 	}
 	alp.mu.Unlock()
 }
+
+func TestAgentMappingCIDR(t *testing.T) {
+	alp := &agentLogPoller{}
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Agents, _ = helpers.NewSubnetMap(map[string]netip.Addr{
+		"192.0.2.0/24": netip.MustParseAddr("192.0.2.10"),
+	})
+	c := NewMock(t, r, config, Dependencies{Daemon: daemon.NewMock(t)})
+	c.poller = alp
+
+	for _, exporter := range []string{"192.0.2.1", "192.0.2.254"} {
+		expectSNMPLookup(t, c, exporter, 766, answer{NOk: true})
+		time.Sleep(20 * time.Millisecond)
+		alp.mu.Lock()
+		if alp.lastAgent != "192.0.2.10" {
+			alp.mu.Unlock()
+			t.Fatalf("exporter %s: last agent should have been 192.0.2.10, not %s", exporter, alp.lastAgent)
+		}
+		alp.mu.Unlock()
+	}
+}
+
+func TestAgentMappingMixedFamilies(t *testing.T) {
+	alp := &agentLogPoller{}
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Agents, _ = helpers.NewSubnetMap(map[string]netip.Addr{
+		"192.0.2.0/24":  netip.MustParseAddr("192.0.2.10"),
+		"2001:db8::/32": netip.MustParseAddr("2001:db8::10"),
+	})
+	c := NewMock(t, r, config, Dependencies{Daemon: daemon.NewMock(t)})
+	c.poller = alp
+
+	expectSNMPLookup(t, c, "192.0.2.1", 766, answer{NOk: true})
+	time.Sleep(20 * time.Millisecond)
+	alp.mu.Lock()
+	if alp.lastAgent != "192.0.2.10" {
+		alp.mu.Unlock()
+		t.Fatalf("IPv4 exporter: last agent should have been 192.0.2.10, not %s", alp.lastAgent)
+	}
+	alp.mu.Unlock()
+
+	expectSNMPLookup(t, c, "2001:db8::1", 766, answer{NOk: true})
+	time.Sleep(20 * time.Millisecond)
+	alp.mu.Lock()
+	if alp.lastAgent != "2001:db8::10" {
+		alp.mu.Unlock()
+		t.Fatalf("IPv6 exporter: last agent should have been 2001:db8::10, not %s", alp.lastAgent)
+	}
+	alp.mu.Unlock()
+}
+
+func TestExporterAlias(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.ExporterAliases, _ = helpers.NewSubnetMap(map[string]string{
+		"127.0.0.1/32": "router1",
+	})
+	c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+
+	// Aliased exporter: ExporterName is the alias, not the IP-derived name.
+	expectSNMPLookup(t, c, "127.0.0.1", 765, answer{NOk: true})
+	time.Sleep(20 * time.Millisecond)
+	expectSNMPLookup(t, c, "127.0.0.1", 765, answer{
+		ExporterName: "router1",
+		Interface:    Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
+	})
+
+	// Non-aliased exporter: falls back to the IP-derived name, as usual.
+	expectSNMPLookup(t, c, "127.0.0.2", 765, answer{NOk: true})
+	time.Sleep(20 * time.Millisecond)
+	expectSNMPLookup(t, c, "127.0.0.2", 765, answer{
+		ExporterName: "127_0_0_2",
+		Interface:    Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
+	})
+
+	// Metrics emitted for the aliased exporter are labelled with the alias.
+	c.metrics.pollerBackoffSeconds.WithLabelValues("router1").Set(0)
+	gotMetrics := r.GetMetrics("akvorado_inlet_snmp_poller_", "backoff_seconds")
+	if _, ok := gotMetrics[`backoff_seconds{exporter="router1"}`]; !ok {
+		t.Errorf("expected a backoff_seconds metric labelled with the alias, got %v", gotMetrics)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
+
+	expectSNMPLookup(t, c, "127.0.0.1", 765, answer{NOk: true})
+	time.Sleep(20 * time.Millisecond)
+	expectSNMPLookup(t, c, "127.0.0.1", 765, answer{
+		ExporterName: "127_0_0_1",
+		Interface:    Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
+	})
+
+	snapshot, err := c.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() error:\n%+v", err)
+	}
+	if len(snapshot) != 1 {
+		t.Fatalf("Snapshot() = %d entries, want 1", len(snapshot))
+	}
+
+	other := NewMock(t, reporter.NewMock(t), DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
+	// Before bootstrapping, a fresh component's cache is empty: lookups miss.
+	expectSNMPLookup(t, other, "127.0.0.2", 765, answer{NOk: true})
+
+	if err := other.Restore(snapshot); err != nil {
+		t.Fatalf("Restore() error:\n%+v", err)
+	}
+	expectSNMPLookup(t, other, "127.0.0.1", 765, answer{
+		ExporterName: "127_0_0_1",
+		Interface:    Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
+	})
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"akvorado/common/reporter"
+)
+
+// fakeUnknownIfIndex is the sentinel ifIndex fakePoller treats as an
+// interface it cannot describe: it still answers (so the exporter name gets
+// cached), but with a zero Interface, mimicking an exporter that does not
+// know about that ifIndex.
+const fakeUnknownIfIndex = 999
+
+// fakePoller answers SNMP polls with deterministic, synthetic data. It is
+// used by NewMock so other components can exercise the SNMP component
+// without a real exporter to talk to.
+type fakePoller struct {
+	put     putFunc
+	resolve func(exporterIP netip.Addr) resolvedExporter
+}
+
+func newFakePoller(put putFunc, resolve func(netip.Addr) resolvedExporter) *fakePoller {
+	return &fakePoller{put: put, resolve: resolve}
+}
+
+// Poll rejects the poll, like a real exporter configured with a different
+// community would, unless the resolved community is "public".
+func (p *fakePoller) Poll(_ context.Context, exporterIP, _ netip.Addr, _ uint16, ifIndexes []uint) error {
+	if resolved := p.resolve(exporterIP); resolved.Community != "public" {
+		return fmt.Errorf("bad community for %s", exporterIP)
+	}
+	exporterName := exporterNameFromIP(exporterIP)
+	for _, ifIndex := range ifIndexes {
+		if ifIndex == fakeUnknownIfIndex {
+			p.put(exporterIP, ifIndex, exporterName, Interface{})
+			continue
+		}
+		p.put(exporterIP, ifIndex, exporterName, Interface{
+			Name:        fmt.Sprintf("Gi0/0/%d", ifIndex),
+			Description: fmt.Sprintf("Interface %d", ifIndex),
+			Speed:       1000,
+		})
+	}
+	return nil
+}
+
+// NewMock creates a new SNMP component for tests, using a fake poller
+// answering with synthetic data instead of talking SNMP to a real exporter.
+func NewMock(t *testing.T, r *reporter.Reporter, config Configuration, dependencies Dependencies) *Component {
+	t.Helper()
+	c, err := New(r, config, dependencies)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	c.poller = newFakePoller(c.putWithAlias(c.cache.Put), c.resolve)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	t.Cleanup(func() {
+		if err := c.Stop(); err != nil {
+			t.Fatalf("Stop() error:\n%+v", err)
+		}
+	})
+	return c
+}